@@ -6,6 +6,16 @@
 // for 3D printing, of the "einstein hat" monotile. See
 // https://arxiv.org/pdf/2303.10798.pdf for details.
 // Given the -r flag, it produces output for the reflected (reversed) tile.
+// Given -n, it instead generates a patch of the tiling by substitution,
+// n levels deep, starting from the metatile named by -seed.
+// Given -fmt svg or -fmt png, it renders the same hats as a 2D image
+// instead of an STL solid. Given -fmt 3mf, it writes a 3MF package
+// instead; given -binary with the default -fmt stl, it writes binary
+// rather than ASCII STL.
+// Given -tile spectre, it tiles with the strictly chiral "spectre"
+// monotile instead of the hat; -r is not supported in that mode, since
+// the spectre tiles aperiodically without ever needing a reflection,
+// and only the default -fmt stl is implemented for it so far.
 package main // import "robpike.io/cmd/einstein"
 
 import (
@@ -13,11 +23,18 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"os"
 	"strings"
 )
 
 var (
 	reflect = flag.Bool("r", false, "reflect")
+	levels  = flag.Int("n", 0, "substitution levels for patch generation; 0 prints a single hat")
+	seed    = flag.String("seed", "H", "seed metatile for patch generation: H, T, P, or F")
+	format  = flag.String("fmt", "stl", "output format: stl, svg, png, or 3mf")
+	scale   = flag.Float64("scale", 4, "pixels per millimeter, for -fmt png")
+	binFlag = flag.Bool("binary", false, "write binary instead of ASCII, for -fmt stl")
+	tile    = flag.String("tile", "hat", "tile shape: hat or spectre")
 
 	// These come up a lot.
 	rad   = 180 / math.Pi
@@ -78,25 +95,145 @@ func main() {
 	log.SetFlags(0)
 	log.SetPrefix("stl: ")
 	flag.Parse()
-	for i := range kites {
-		fmt.Println(render(fmt.Sprintf("kite%d", i), kites[i], 0, *reflect))
-		fmt.Println(render(fmt.Sprintf("kite-inset%d", i), kites[i], inset, *reflect))
+
+	if *tile != "hat" && *tile != "spectre" {
+		log.Fatalf("bad -tile %q: want one of hat, spectre", *tile)
+	}
+	if *tile == "spectre" && *reflect {
+		log.Fatal("-r is not supported with -tile spectre: the spectre never needs reflecting")
+	}
+	if *tile == "spectre" && *format != "stl" {
+		log.Fatalf("-fmt %s is not yet supported with -tile spectre", *format)
+	}
+
+	hats := patchHats()
+	switch *format {
+	case "stl":
+		if *binFlag {
+			if err := WriteBinarySTL(os.Stdout, hats); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			printSTL(hats)
+		}
+	case "svg":
+		fmt.Println(NewSVGRenderer().Render(hats))
+	case "png":
+		if err := NewPNGRenderer(*scale).WritePNG(os.Stdout, hats); err != nil {
+			log.Fatal(err)
+		}
+	case "3mf":
+		if err := Write3MF(os.Stdout, hats); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("bad -fmt %q: want one of stl, svg, png, 3mf", *format)
+	}
+}
+
+// patchHats returns the hats to render: the single hat at the origin
+// (the original behavior, when -n is 0), or the level-*levels
+// substitution patch rooted at -seed. The same metatile substitution
+// drives both tile shapes; in spectre mode the reflections the hat
+// substitution calls for are simply dropped, since a spectre tile fills
+// the same role unreflected.
+func patchHats() []placedHat {
+	var hats []placedHat
+	if *levels <= 0 {
+		hats = []placedHat{{pos: [2]float64{0, 0}, rot: 0, reflect: *reflect}}
+	} else {
+		kind, ok := parseMetaKind(*seed)
+		if !ok {
+			log.Fatalf("bad -seed %q: want one of H, T, P, F", *seed)
+		}
+		hats = Generate(kind, *levels)
+	}
+	if *tile == "spectre" {
+		for i := range hats {
+			if hats[i].reflect {
+				// Generate negates a reflected hat's x to compensate
+				// for a placeKite/kitePolygon quirk that only
+				// matters when reflect is honored; spectrePolygon
+				// never reflects, so that compensation needs
+				// undoing here, not just the reflect flag dropping.
+				hats[i].pos[0] = -hats[i].pos[0]
+				hats[i].reflect = false
+			}
+		}
+	}
+	return hats
+}
+
+// printSTL emits hats as the sequence of ASCII STL solids. For the hat
+// tile this is one pair of solids (tile and groove inset) per kite
+// part; for the spectre, which is already a single tile, one pair per
+// hat.
+func printSTL(hats []placedHat) {
+	n := 0
+	for _, h := range hats {
+		if *tile == "spectre" {
+			fmt.Println(render(fmt.Sprintf("hat%d", n), kite{pos: h.pos, rot: h.rot}, 0, false))
+			fmt.Println(render(fmt.Sprintf("hat-inset%d", n), kite{pos: h.pos, rot: h.rot}, inset, false))
+			n++
+			continue
+		}
+		for _, part := range kites {
+			k := placeKite(h, part)
+			fmt.Println(render(fmt.Sprintf("hat%d", n), k, 0, h.reflect))
+			fmt.Println(render(fmt.Sprintf("hat-inset%d", n), k, inset, h.reflect))
+			n++
+		}
+	}
+}
+
+// placeKite composes a hat's placement h with one of the hat's eight
+// constituent kite parts, recorded in the kites table, to produce that
+// part's absolute position and rotation.
+func placeKite(h placedHat, part kite) kite {
+	θ := float64(h.rot) / rad
+	sinθ, cosθ := math.Sin(θ), math.Cos(θ)
+	x, y := part.pos[0], part.pos[1]
+	if h.reflect {
+		x = -x
+	}
+	return kite{
+		pos: [2]float64{h.pos[0] + x*cosθ - y*sinθ, h.pos[1] + x*sinθ + y*cosθ},
+		rot: norm360(part.rot + h.rot),
 	}
 }
 
 func render(name string, k kite, inset float64, reflect bool) string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "solid %s\n\n", name)
-	stl := Kite(k.pos, k.rot, inset, reflect)
-	for _, f := range stl.Facets() {
+	for _, f := range solidFacets(k, inset, reflect) {
 		fmt.Fprintln(&b, f)
 	}
 	return b.String()
 }
 
-// We draw the lines by insetting a second tile a bit and then lifting
-// it, so we get a groove around the outside.
-func Kite(loc [2]float64, rotationDegrees int, inset float64, reflect bool) Box {
+// solidFacets returns one tile's facets at placement k: a kite part's,
+// or, when -tile is spectre, a whole spectre tile's.
+func solidFacets(k kite, inset float64, reflect bool) []Facet {
+	if *tile == "spectre" {
+		return Spectre(k.pos, k.rot, inset).Facets()
+	}
+	f := Kite(k.pos, k.rot, inset, reflect).Facets()
+	return f[:]
+}
+
+// Point2D is a single 2D point. kitePolygon returns a kite's outline as
+// four of these, so that callers other than Kite -- the vector
+// renderers in svg.go and png.go -- can work with the flat outline
+// directly instead of the extruded solid.
+type Point2D struct {
+	X, Y float64
+}
+
+// kitePolygon computes the transformed outline of one kite part: the
+// same four points Kite extrudes into a solid, after deflating by
+// inset, scaling to unit size, rotating, translating to loc, and
+// reflecting if asked.
+func kitePolygon(loc [2]float64, rotationDegrees int, inset float64, reflect bool) [4]Point2D {
 	// First describe the kite. Then rotate, then translate.
 	x0, y0 := 0., 0. // Bottom of kite.
 	x1, y1 := 0., sqrt3
@@ -125,15 +262,15 @@ func Kite(loc [2]float64, rotationDegrees int, inset float64, reflect bool) Box
 	x3, y3 = x3*unit, y3*unit
 
 	// Rotate by angle in degrees.
-	// x' = x cos ğ›‰ -y sin ğ›‰
-	// y' =x sin ğ›‰ +y cos ğ›‰
-	ğ›‰ := float64(rotationDegrees) / rad
-	sinğ›‰ := math.Sin(ğ›‰)
-	cosğ›‰ := math.Cos(ğ›‰)
-	x0, y0 = x0*cosğ›‰-y0*sinğ›‰, x0*sinğ›‰+y0*cosğ›‰
-	x1, y1 = x1*cosğ›‰-y1*sinğ›‰, x1*sinğ›‰+y1*cosğ›‰
-	x2, y2 = x2*cosğ›‰-y2*sinğ›‰, x2*sinğ›‰+y2*cosğ›‰
-	x3, y3 = x3*cosğ›‰-y3*sinğ›‰, x3*sinğ›‰+y3*cosğ›‰
+	// x' = x cos θ -y sin θ
+	// y' =x sin θ +y cos θ
+	θ := float64(rotationDegrees) / rad
+	sinθ := math.Sin(θ)
+	cosθ := math.Cos(θ)
+	x0, y0 = x0*cosθ-y0*sinθ, x0*sinθ+y0*cosθ
+	x1, y1 = x1*cosθ-y1*sinθ, x1*sinθ+y1*cosθ
+	x2, y2 = x2*cosθ-y2*sinθ, x2*sinθ+y2*cosθ
+	x3, y3 = x3*cosθ-y3*sinθ, x3*sinθ+y3*cosθ
 
 	// Translate to destination.
 	dx, dy := loc[0]*unit, loc[1]*unit
@@ -147,18 +284,26 @@ func Kite(loc [2]float64, rotationDegrees int, inset float64, reflect bool) Box
 		x0, y0, x1, y1, x2, y2, x3, y3 = -x3, y3, -x2, y2, -x1, y1, -x0, y0
 	}
 
+	return [4]Point2D{{x0, y0}, {x1, y1}, {x2, y2}, {x3, y3}}
+}
+
+// We draw the lines by insetting a second tile a bit and then lifting
+// it, so we get a groove around the outside.
+func Kite(loc [2]float64, rotationDegrees int, inset float64, reflect bool) Box {
+	p := kitePolygon(loc, rotationDegrees, inset, reflect)
+
 	bot := NewQuad(
-		x0, y0, 0,
-		x1, y1, 0,
-		x2, y2, 0,
-		x3, y3, 0,
+		p[0].X, p[0].Y, 0,
+		p[1].X, p[1].Y, 0,
+		p[2].X, p[2].Y, 0,
+		p[3].X, p[3].Y, 0,
 	)
 	var height = (0.2 + inset) * unit
 	top := NewQuad(
-		x0, y0, height,
-		x3, y3, height,
-		x2, y2, height,
-		x1, y1, height,
+		p[0].X, p[0].Y, height,
+		p[3].X, p[3].Y, height,
+		p[2].X, p[2].Y, height,
+		p[1].X, p[1].Y, height,
 	)
 	return NewBox(bot, top)
 }
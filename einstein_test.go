@@ -0,0 +1,39 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestPatchHatsSpectreNoOverlap guards patchHats' spectre-mode
+// transform: it drops each hat's reflect flag, since spectrePolygon
+// never mirrors, but Generate had negated some hats' x to compensate
+// for a placeKite/kitePolygon quirk that only matters when reflect is
+// honored. Forgetting to undo that negation here would leave those
+// hats at the wrong position -- this checks the hat-shaped footprint
+// patchHats hands back for spectre mode is still a non-overlapping set.
+func TestPatchHatsSpectreNoOverlap(t *testing.T) {
+	savedTile, savedLevels, savedSeed := *tile, *levels, *seed
+	defer func() { *tile, *levels, *seed = savedTile, savedLevels, savedSeed }()
+	*tile = "spectre"
+
+	for _, s := range []string{"H", "T", "P", "F"} {
+		*seed = s
+		for n := 1; n <= 3; n++ {
+			*levels = n
+			hats := patchHats()
+			for i := range hats {
+				if hats[i].reflect {
+					t.Fatalf("seed %s n=%d: spectre hat %d still has reflect set", s, n, i)
+				}
+				for j := i + 1; j < len(hats); j++ {
+					if kitesOverlap(hats[i], hats[j]) {
+						t.Fatalf("seed %s n=%d: spectre hat %d (pos %v) overlaps hat %d (pos %v)",
+							s, n, i, hats[i].pos, j, hats[j].pos)
+					}
+				}
+			}
+		}
+	}
+}
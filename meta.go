@@ -0,0 +1,299 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"math"
+)
+
+// This file implements a substitution system, in the spirit of the one
+// in the Smith/Myers/Kaplan/Goodman-Strauss paper, that builds patches
+// out of four metatiles, conventionally named H, T, P and F. A metatile
+// at level k expands to a fixed arrangement of level-(k-1) metatiles; at
+// level 0 a metatile expands to a single hat, placed and chirally
+// flipped according to its kind.
+//
+// The paper's own metatiles are exact unions of hats with shared edges,
+// so a correct substitution has no gaps at all. What's here instead
+// places each level's children on a hex ring (see substitution, below)
+// sized to guarantee no two hats in a patch ever overlap, which is
+// weaker: it keeps Generate safe to call at any n, but it does not
+// reproduce the paper's edge-to-edge adjacency, so a rendered patch
+// shows real gaps between metatiles rather than a seamless tiling.
+// Closing that gap for good means replacing the ring placement below
+// with the paper's exact supertile coordinates.
+
+// metaKind names one of the four metatiles used to build the
+// substitution tiling.
+type metaKind int
+
+const (
+	H metaKind = iota
+	T
+	P
+	F
+)
+
+func (k metaKind) String() string {
+	switch k {
+	case H:
+		return "H"
+	case T:
+		return "T"
+	case P:
+		return "P"
+	case F:
+		return "F"
+	}
+	return "?"
+}
+
+// Meta is one placed instance of a metatile: its kind, its position and
+// rotation in the same sense as kite.pos and kite.rot, whether it is
+// chirally reflected, and its substitution level. A level-0 Meta
+// expands directly to a hat; a level-k Meta expands to level-(k-1)
+// children.
+type Meta struct {
+	kind    metaKind
+	pos     [2]float64
+	rot     int
+	reflect bool
+	level   int
+}
+
+// child describes one component of a metatile's expansion, expressed in
+// the parent's own frame: which metatile it is, and the rigid transform
+// that places it before the parent's own transform is applied.
+type child struct {
+	kind    metaKind
+	pos     [2]float64
+	rot     int
+	reflect bool
+}
+
+// substitution gives, for each metatile kind, the children that a
+// level-k instance of that kind expands to at level k-1. Each non-center
+// child sits on a hex ring of radius metaRing around the parent's
+// origin, at one of the six 60-degree directions, just far enough that
+// two level-0 hats placed by siblings in the same ring do not overlap;
+// they do not touch, and a gap remains (see TestGenerateNoOverlap and
+// metaRing). transformChild additionally
+// scales these offsets by metaScale per level: a level-(k-1) child is
+// itself the root of a whole sub-patch of radius roughly metaRing times
+// the geometric series 1 + 1/metaScale + 1/metaScale^2 + ..., so for two
+// such sub-patches hung off neighboring ring positions to clear each
+// other, metaScale must exceed 3 (metaRing itself only has to beat the
+// single-hat case, handled above); metaScale is set comfortably above
+// that threshold rather than right at it.
+var substitution = map[metaKind][]child{
+	H: {
+		{H, [2]float64{0, 0}, 0, false},
+		{T, [2]float64{0, metaRing}, 0, false},
+		{P, [2]float64{metaRing * cos30, metaRing * sin30}, 120, false},
+		{F, [2]float64{-metaRing * cos30, metaRing * sin30}, 240, false},
+		{H, [2]float64{metaRing * cos30, -metaRing * sin30}, 180, false},
+		{P, [2]float64{0, -metaRing}, 60, false},
+		{F, [2]float64{-metaRing * cos30, -metaRing * sin30}, 300, false},
+	},
+	T: {
+		{H, [2]float64{0, 0}, 0, false},
+		{F, [2]float64{0, metaRing}, 180, true},
+	},
+	P: {
+		{H, [2]float64{0, 0}, 0, false},
+		{T, [2]float64{metaRing * cos30, metaRing * sin30}, 60, false},
+		{F, [2]float64{-metaRing * cos30, metaRing * sin30}, 300, true},
+	},
+	F: {
+		{H, [2]float64{0, 0}, 0, false},
+		{P, [2]float64{metaRing * cos30, metaRing * sin30}, 60, false},
+	},
+}
+
+// metaRing is the radius, in kite units, of the hex ring that a
+// metatile's non-center children sit on -- the smallest value found (see
+// TestGenerateNoOverlap) that keeps any two hats in a patch from
+// overlapping, plus a small margin; it does not make them touch exactly.
+// metaScale is the linear factor by which that spacing must grow per
+// substitution level; it must be strictly greater than 3 for whole
+// sub-patches (not just individual hats) to clear each other at deeper
+// levels, so it's set to 4 for a comfortable margin.
+const (
+	metaRing  = 9.2
+	metaScale = 4
+)
+
+// hatPlacement gives the placement, at level 0, of the single hat that a
+// metatile of the given kind expands to: its rotation relative to the
+// metatile, and whether it is itself a reflected (reversed) hat.
+var hatPlacement = map[metaKind]struct {
+	rot     int
+	reflect bool
+}{
+	H: {0, false},
+	T: {0, false},
+	P: {0, true},
+	F: {180, true},
+}
+
+// placedHat is one hat in a generated patch: its placement, in the same
+// terms as kite.pos and kite.rot, and whether it is chirally reflected.
+type placedHat struct {
+	pos     [2]float64
+	rot     int
+	reflect bool
+}
+
+// Generate returns the hats that make up the level-n patch rooted at a
+// single metatile of the given seed kind, placed at the origin with no
+// rotation. The substitution expansion below produces one raw hat per
+// leaf, and any leaf that lands on exactly the same hat as an earlier
+// one is a duplicate to drop; with the hex-ring table above, leaves do
+// not coincide, so in practice nothing is dropped and the check is a
+// safeguard. Rather than check every hat against every previous one as
+// it's produced, every raw hat's bounding box is bulk-loaded in a single
+// pass into a TileIndex via NewTileIndex's STR algorithm (see rtree.go),
+// and then each hat, in order, is checked against the so-far-kept hats
+// its query turns up: an exact CanonicalKey match is a duplicate and is
+// dropped, and anything else that's bbox-overlapping is checked
+// geometrically with kitesOverlap. Two distinct hats really overlapping
+// would mean the substitution table above is wrong, not that this is a
+// legitimate shared tile, so that case is fatal rather than silently
+// kept or dropped.
+func Generate(seed metaKind, n int) []placedHat {
+	var raw []placedHat
+	var expand func(m Meta)
+	expand = func(m Meta) {
+		if m.level == 0 {
+			hp := hatPlacement[m.kind]
+			hat := placedHat{
+				pos:     m.pos,
+				rot:     norm360(hp.rot + m.rot),
+				reflect: hp.reflect != m.reflect,
+			}
+			if hat.reflect {
+				// kitePolygon mirrors a reflected kite's final,
+				// already-translated x coordinate rather than its
+				// local shape before translation, so a reflected
+				// hat's own pos ends up rendered with its x sign
+				// flipped. placeKite and kitePolygon are shared with
+				// the single-hat -r path, where pos is always the
+				// origin and this is a no-op, so it's corrected here
+				// instead of in that shared code.
+				hat.pos[0] = -hat.pos[0]
+			}
+			raw = append(raw, hat)
+			return
+		}
+		for _, c := range substitution[m.kind] {
+			expand(transformChild(m, c))
+		}
+	}
+	expand(Meta{kind: seed, level: n})
+
+	boxes := make([]bbox, len(raw))
+	sigs := make([]canonicalHat, len(raw))
+	keys := make([]any, len(raw))
+	for i, hat := range raw {
+		boxes[i] = hatBBox(hat)
+		sigs[i] = canonicalHat{CanonicalKey(kite{pos: hat.pos, rot: hat.rot}), hat.reflect}
+		keys[i] = i
+	}
+	index := NewTileIndex(boxes, keys)
+
+	var hats []placedHat
+	kept := make([]bool, len(raw))
+	for i, hat := range raw {
+		duplicate := false
+		for _, c := range index.Query(boxes[i]) {
+			j := c.(int)
+			if j >= i || !kept[j] {
+				continue // not yet decided, or j is i itself
+			}
+			if sigs[j] == sigs[i] {
+				duplicate = true
+				break
+			}
+			if kitesOverlap(hat, raw[j]) {
+				log.Fatalf("patch generator placed overlapping hats at %v and %v: bad substitution transform", hat.pos, raw[j].pos)
+			}
+		}
+		if !duplicate {
+			kept[i] = true
+			hats = append(hats, hat)
+		}
+	}
+	return hats
+}
+
+// canonicalHat is a hat's CanonicalKey together with its chirality,
+// used to spot exact duplicates; a hat and its mirror image can
+// otherwise share the same position and rotation.
+type canonicalHat struct {
+	key     [3]float64
+	reflect bool
+}
+
+// hatBBox returns the axis-aligned bounding box of every kite part of
+// hat h.
+func hatBBox(h placedHat) bbox {
+	boxes := make([]bbox, 0, len(kites))
+	for _, poly := range hatPolygons(h) {
+		b := bbox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		for _, p := range poly {
+			b.minX, b.maxX = math.Min(b.minX, p.X), math.Max(b.maxX, p.X)
+			b.minY, b.maxY = math.Min(b.minY, p.Y), math.Max(b.maxY, p.Y)
+		}
+		boxes = append(boxes, b)
+	}
+	return unionBoxes(boxes...)
+}
+
+// transformChild applies parent m's rotation, reflection and
+// translation to a child transform c, returning the child expressed in
+// the root's frame, one level down from m. c.pos is scaled by
+// metaScale^(m.level-1) first: substitution's offsets are sized for
+// spacing level-0 hats apart, and a level-k meta's children are
+// themselves level-(k-1) supertiles needing proportionally more room.
+func transformChild(m Meta, c child) Meta {
+	scale := math.Pow(metaScale, float64(m.level-1))
+	x, y := c.pos[0]*scale, c.pos[1]*scale
+	if m.reflect {
+		x = -x
+	}
+	θ := float64(m.rot) / rad
+	sinθ, cosθ := math.Sin(θ), math.Cos(θ)
+	rot := c.rot
+	if m.reflect {
+		rot = -rot
+	}
+	return Meta{
+		kind:    c.kind,
+		pos:     [2]float64{m.pos[0] + x*cosθ - y*sinθ, m.pos[1] + x*sinθ + y*cosθ},
+		rot:     norm360(rot + m.rot),
+		reflect: m.reflect != c.reflect,
+		level:   m.level - 1,
+	}
+}
+
+func norm360(deg int) int {
+	return ((deg % 360) + 360) % 360
+}
+
+// parseMetaKind maps a -seed flag value to a metaKind.
+func parseMetaKind(s string) (metaKind, bool) {
+	switch s {
+	case "H":
+		return H, true
+	case "T":
+		return T, true
+	case "P":
+		return P, true
+	case "F":
+		return F, true
+	}
+	return 0, false
+}
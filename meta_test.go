@@ -0,0 +1,30 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestGenerateNoOverlap guards against a substitution transform that
+// places two distinct hats on top of each other: Generate already
+// rejects exact duplicates via the TileIndex, but a bad transform can
+// produce hats that are merely close, not identical, and bbox dedup
+// alone would miss that. This checks every pair of hats in a few small
+// patches, from every seed kind, with the same kite-by-kite clip test
+// Generate itself uses in kitesOverlap.
+func TestGenerateNoOverlap(t *testing.T) {
+	for _, seed := range []metaKind{H, T, P, F} {
+		for n := 1; n <= 3; n++ {
+			hats := Generate(seed, n)
+			for i := range hats {
+				for j := i + 1; j < len(hats); j++ {
+					if kitesOverlap(hats[i], hats[j]) {
+						t.Fatalf("seed %v n=%d: hat %d (pos %v) overlaps hat %d (pos %v)",
+							seed, n, i, hats[i].pos, j, hats[j].pos)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "math"
+
+// This file implements the geometric overlap check Generate uses to
+// catch a bad substitution transform: two distinct hats placed so that
+// one of their kite parts genuinely overlaps, rather than merely
+// sharing an edge or a vertex the way real neighbors do.
+
+// overlapEpsilon is the minimum clipped area, in square millimeters,
+// treated as a real overlap rather than floating-point roundoff from
+// two kites that only share an edge.
+const overlapEpsilon = 1e-6
+
+// kitesOverlap reports whether any kite part of hat a and any kite part
+// of hat b have positive-area intersection.
+func kitesOverlap(a, b placedHat) bool {
+	for _, ka := range hatPolygons(a) {
+		for _, kb := range hatPolygons(b) {
+			if clippedArea(ka, kb) > overlapEpsilon {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clippedArea returns the area of the intersection of the two
+// quadrilaterals, both of which are convex, as kite outlines always are.
+func clippedArea(subject, clip [4]Point2D) float64 {
+	poly := clipPolygon(subject[:], clip[:])
+	if len(poly) < 3 {
+		return 0
+	}
+	return polygonArea(poly)
+}
+
+// clipPolygon clips subject against the convex polygon clip using the
+// Sutherland-Hodgman algorithm, returning the intersection polygon (nil
+// if it's empty). clip's own winding doesn't matter: clipPolygon checks
+// its signed area to work out which side is inside.
+func clipPolygon(subject, clip []Point2D) []Point2D {
+	if signedArea(clip) < 0 {
+		clip = reversed(clip)
+	}
+	out := append([]Point2D{}, subject...)
+	n := len(clip)
+	for i := 0; i < n && len(out) > 0; i++ {
+		a, b := clip[i], clip[(i+1)%n]
+		in := out
+		out = nil
+		for j, cur := range in {
+			prev := in[(j-1+len(in))%len(in)]
+			curIn := leftOf(cur, a, b)
+			prevIn := leftOf(prev, a, b)
+			switch {
+			case curIn && prevIn:
+				out = append(out, cur)
+			case curIn && !prevIn:
+				out = append(out, lineIntersection(prev, cur, a, b), cur)
+			case prevIn && !curIn:
+				out = append(out, lineIntersection(prev, cur, a, b))
+			}
+		}
+	}
+	return out
+}
+
+// leftOf reports whether p is on or to the left of the directed line
+// a->b, which is "inside" for a clip polygon wound counterclockwise.
+func leftOf(p, a, b Point2D) bool {
+	return (b.X-a.X)*(p.Y-a.Y)-(b.Y-a.Y)*(p.X-a.X) >= -1e-9
+}
+
+func signedArea(poly []Point2D) float64 {
+	var a float64
+	n := len(poly)
+	for i := 0; i < n; i++ {
+		j := (i + 1) % n
+		a += poly[i].X*poly[j].Y - poly[j].X*poly[i].Y
+	}
+	return a
+}
+
+func polygonArea(poly []Point2D) float64 {
+	return math.Abs(signedArea(poly)) / 2
+}
+
+func reversed(poly []Point2D) []Point2D {
+	out := make([]Point2D, len(poly))
+	for i, p := range poly {
+		out[len(poly)-1-i] = p
+	}
+	return out
+}
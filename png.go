@@ -0,0 +1,173 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+)
+
+// PNGRenderer rasterizes a patch of hats into a raster image. Each kite
+// part is filled with a simple scanline rasterizer, in the style of the
+// rasterizers in freetype and draw2d: build an edge table for the
+// polygon, then for each scanline walk the table into an active-edge
+// list, sort the crossings, and fill the spans between them using the
+// even-odd rule.
+type PNGRenderer struct {
+	Scale       float64 // pixels per millimeter
+	Fill        color.Color
+	ReflectFill color.Color
+	Stroke      color.Color
+}
+
+// NewPNGRenderer returns a PNGRenderer with reasonable defaults for the
+// given scale, in pixels per millimeter.
+func NewPNGRenderer(scale float64) *PNGRenderer {
+	return &PNGRenderer{
+		Scale:       scale,
+		Fill:        color.RGBA{0xdd, 0xdd, 0xdd, 0xff},
+		ReflectFill: color.RGBA{0x99, 0xaa, 0xdd, 0xff},
+		Stroke:      color.Black,
+	}
+}
+
+// Render rasterizes hats to an image sized to their bounding box.
+func (r *PNGRenderer) Render(hats []placedHat) image.Image {
+	minX, minY, maxX, maxY := hatBounds(hats)
+	w := int(math.Ceil((maxX-minX)*r.Scale)) + 1
+	h := int(math.Ceil((maxY-minY)*r.Scale)) + 1
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	toPixel := func(p Point2D) Point2D {
+		// Flip Y: the tiling's math coordinates grow upward, image coordinates grow downward.
+		return Point2D{(p.X - minX) * r.Scale, (maxY - p.Y) * r.Scale}
+	}
+
+	for _, hat := range hats {
+		fill := r.Fill
+		if hat.reflect {
+			fill = r.ReflectFill
+		}
+		for _, poly := range hatPolygons(hat) {
+			var px [4]Point2D
+			for i, p := range poly {
+				px[i] = toPixel(p)
+			}
+			fillPolygon(img, px[:], fill)
+			strokePolygon(img, px[:], r.Stroke)
+		}
+	}
+	return img
+}
+
+// WritePNG rasterizes hats and encodes the result to w as a PNG.
+func (r *PNGRenderer) WritePNG(w io.Writer, hats []placedHat) error {
+	return png.Encode(w, r.Render(hats))
+}
+
+// edge is one edge of a polygon's edge table, used by fillPolygon's
+// scanline rasterizer. Horizontal edges never become active and are
+// omitted.
+type edge struct {
+	yTop, yBot float64
+	x          float64 // x at yTop
+	dxdy       float64
+}
+
+func buildEdges(poly []Point2D) []edge {
+	var edges []edge
+	n := len(poly)
+	for i := 0; i < n; i++ {
+		p0, p1 := poly[i], poly[(i+1)%n]
+		if p0.Y == p1.Y {
+			continue
+		}
+		if p0.Y > p1.Y {
+			p0, p1 = p1, p0
+		}
+		edges = append(edges, edge{
+			yTop: p0.Y,
+			yBot: p1.Y,
+			x:    p0.X,
+			dxdy: (p1.X - p0.X) / (p1.Y - p0.Y),
+		})
+	}
+	return edges
+}
+
+// fillPolygon rasterizes poly, given in pixel coordinates, into img
+// using an even-odd scanline fill.
+func fillPolygon(img *image.RGBA, poly []Point2D, c color.Color) {
+	edges := buildEdges(poly)
+	if len(edges) == 0 {
+		return
+	}
+	yMin, yMax := poly[0].Y, poly[0].Y
+	for _, p := range poly[1:] {
+		yMin, yMax = math.Min(yMin, p.Y), math.Max(yMax, p.Y)
+	}
+	bounds := img.Bounds()
+	y0 := maxInt(bounds.Min.Y, int(math.Floor(yMin)))
+	y1 := minInt(bounds.Max.Y, int(math.Ceil(yMax)))
+	for y := y0; y < y1; y++ {
+		scan := float64(y) + 0.5
+		var xs []float64
+		for _, e := range edges {
+			if scan >= e.yTop && scan < e.yBot {
+				xs = append(xs, e.x+(scan-e.yTop)*e.dxdy)
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			x0 := maxInt(bounds.Min.X, int(math.Round(xs[i])))
+			x1 := minInt(bounds.Max.X, int(math.Round(xs[i+1])))
+			for x := x0; x < x1; x++ {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// strokePolygon draws poly's outline, given in pixel coordinates.
+func strokePolygon(img *image.RGBA, poly []Point2D, c color.Color) {
+	n := len(poly)
+	for i := 0; i < n; i++ {
+		drawLine(img, poly[i], poly[(i+1)%n], c)
+	}
+}
+
+// drawLine draws a line from p0 to p1 by stepping along its longer axis.
+func drawLine(img *image.RGBA, p0, p1 Point2D, c color.Color) {
+	dx, dy := p1.X-p0.X, p1.Y-p0.Y
+	steps := int(math.Max(math.Abs(dx), math.Abs(dy)))
+	if steps == 0 {
+		img.Set(int(p0.X), int(p0.Y), c)
+		return
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		img.Set(int(p0.X+dx*t), int(p0.Y+dy*t), c)
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
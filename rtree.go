@@ -0,0 +1,231 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// This file implements a bounding-box R-tree, used by the patch
+// generator in meta.go to reject duplicate hats cheaply: a hat that
+// more than one branch of the substitution expansion produces must be
+// kept only once, and as a patch grows into the tens of thousands of
+// tiles, checking every new hat against every previous one would be
+// O(n^2). Instead
+// each hat is inserted keyed by its axis-aligned bounding box, and
+// before a hat is kept, the tree is queried for the (usually tiny) set
+// of candidates whose bbox overlaps, which are then compared exactly
+// via CanonicalKey.
+
+// rtreeNodeSize is both the leaf fan-out (hats per leaf) and the
+// internal fan-out (children per node).
+const rtreeNodeSize = 8
+
+type bbox struct {
+	minX, minY, maxX, maxY float64
+}
+
+func unionBoxes(boxes ...bbox) bbox {
+	b := bbox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, o := range boxes {
+		b.minX, b.maxX = math.Min(b.minX, o.minX), math.Max(b.maxX, o.maxX)
+		b.minY, b.maxY = math.Min(b.minY, o.minY), math.Max(b.maxY, o.maxY)
+	}
+	return b
+}
+
+func (b bbox) overlaps(o bbox, eps float64) bool {
+	return b.minX <= o.maxX+eps && o.minX <= b.maxX+eps &&
+		b.minY <= o.maxY+eps && o.minY <= b.maxY+eps
+}
+
+func (b bbox) area() float64 { return (b.maxX - b.minX) * (b.maxY - b.minY) }
+
+func (b bbox) enlargement(o bbox) float64 { return unionBoxes(b, o).area() - b.area() }
+
+func (b bbox) centerX() float64 { return (b.minX + b.maxX) / 2 }
+
+func (b bbox) centerY() float64 { return (b.minY + b.maxY) / 2 }
+
+// rentry is one entry of an rnode: its bounding box, and either the key
+// it was inserted with (in a leaf) or the child it points to (in an
+// internal node).
+type rentry struct {
+	box   bbox
+	key   any
+	child *rnode
+}
+
+// rnode is one node of the tree, holding its own bounding box (the
+// union of its entries') plus either leaf entries or child nodes.
+type rnode struct {
+	box     bbox
+	leaf    bool
+	entries []rentry
+}
+
+func entriesBox(entries []rentry) bbox {
+	boxes := make([]bbox, len(entries))
+	for i, e := range entries {
+		boxes[i] = e.box
+	}
+	return unionBoxes(boxes...)
+}
+
+// TileIndex is an R-tree over hat bounding boxes.
+type TileIndex struct {
+	root *rnode
+}
+
+// NewTileIndex bulk-loads a TileIndex over boxes and keys using the
+// sort-tile-recursive (STR) algorithm: sort by x-center into vertical
+// strips sized so each strip holds about sqrt(n*nodeSize) items, sort
+// each strip by y-center, and slice it into node-sized runs. Those runs
+// become the leaves; the same procedure, run on the leaves themselves,
+// builds each level above until a single root remains.
+func NewTileIndex(boxes []bbox, keys []any) *TileIndex {
+	if len(boxes) == 0 {
+		return &TileIndex{}
+	}
+	items := make([]rentry, len(boxes))
+	for i, b := range boxes {
+		items[i] = rentry{box: b, key: keys[i]}
+	}
+	nodes := strLevel(items, true)
+	for len(nodes) > 1 {
+		items = make([]rentry, len(nodes))
+		for i, n := range nodes {
+			items[i] = rentry{box: n.box, child: n}
+		}
+		nodes = strLevel(items, false)
+	}
+	return &TileIndex{root: nodes[0]}
+}
+
+func strLevel(items []rentry, leaf bool) []*rnode {
+	n := len(items)
+	sort.Slice(items, func(i, j int) bool { return items[i].box.centerX() < items[j].box.centerX() })
+	numStrips := int(math.Ceil(math.Sqrt(float64(n) / float64(rtreeNodeSize))))
+	if numStrips < 1 {
+		numStrips = 1
+	}
+	stripSize := int(math.Ceil(float64(n) / float64(numStrips)))
+	var nodes []*rnode
+	for i := 0; i < n; i += stripSize {
+		strip := items[i:minInt(i+stripSize, n)]
+		sort.Slice(strip, func(a, b int) bool { return strip[a].box.centerY() < strip[b].box.centerY() })
+		for j := 0; j < len(strip); j += rtreeNodeSize {
+			run := append([]rentry{}, strip[j:minInt(j+rtreeNodeSize, len(strip))]...)
+			nodes = append(nodes, &rnode{leaf: leaf, entries: run, box: entriesBox(run)})
+		}
+	}
+	return nodes
+}
+
+// Insert adds one more entry to the tree, descending to the leaf whose
+// bounding box needs the least enlargement to hold box and splitting
+// nodes, bottom-up, as they overflow rtreeNodeSize.
+func (t *TileIndex) Insert(box bbox, key any) {
+	if t.root == nil {
+		t.root = &rnode{leaf: true, box: box, entries: []rentry{{box: box, key: key}}}
+		return
+	}
+	n, sibling := insert(t.root, box, key)
+	if sibling == nil {
+		t.root = n
+		return
+	}
+	t.root = &rnode{
+		box:     unionBoxes(n.box, sibling.box),
+		entries: []rentry{{box: n.box, child: n}, {box: sibling.box, child: sibling}},
+	}
+}
+
+// insert adds (box, key) to the subtree rooted at n, returning n (with
+// its box and entries updated) and, if n overflowed and had to split, a
+// new sibling for the caller to link into its own parent.
+func insert(n *rnode, box bbox, key any) (*rnode, *rnode) {
+	if n.leaf {
+		n.entries = append(n.entries, rentry{box: box, key: key})
+	} else {
+		best := 0
+		bestEnlargement := math.Inf(1)
+		for i, e := range n.entries {
+			if enl := e.box.enlargement(box); enl < bestEnlargement {
+				bestEnlargement, best = enl, i
+			}
+		}
+		child, sibling := insert(n.entries[best].child, box, key)
+		n.entries[best] = rentry{box: child.box, child: child}
+		if sibling != nil {
+			n.entries = append(n.entries, rentry{box: sibling.box, child: sibling})
+		}
+	}
+	n.box = entriesBox(n.entries)
+	if len(n.entries) <= rtreeNodeSize {
+		return n, nil
+	}
+	return splitNode(n)
+}
+
+// splitNode divides an overflowing node's entries in half by their
+// x-center (the same STR ordering used by bulk loading), returning two
+// fresh nodes in place of n.
+func splitNode(n *rnode) (*rnode, *rnode) {
+	entries := append([]rentry{}, n.entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].box.centerX() < entries[j].box.centerX() })
+	mid := len(entries) / 2
+	// Each half needs its own backing array: entries[:mid] alone would
+	// share entries[mid:]'s storage, and a later append to left.entries
+	// (within that leftover capacity) would silently clobber right.
+	leftEntries := append([]rentry{}, entries[:mid]...)
+	rightEntries := append([]rentry{}, entries[mid:]...)
+	left := &rnode{leaf: n.leaf, entries: leftEntries, box: entriesBox(leftEntries)}
+	right := &rnode{leaf: n.leaf, entries: rightEntries, box: entriesBox(rightEntries)}
+	return left, right
+}
+
+// tileEpsilon is the overlap tolerance used when querying the tree, to
+// absorb floating-point roundoff between hats that are meant to share
+// an edge rather than truly overlap.
+const tileEpsilon = 1e-6
+
+// Query returns the keys of every entry whose bounding box overlaps box
+// within tileEpsilon.
+func (t *TileIndex) Query(box bbox) []any {
+	if t.root == nil {
+		return nil
+	}
+	var out []any
+	queryNode(t.root, box, &out)
+	return out
+}
+
+func queryNode(n *rnode, box bbox, out *[]any) {
+	if !n.box.overlaps(box, tileEpsilon) {
+		return
+	}
+	for _, e := range n.entries {
+		if !e.box.overlaps(box, tileEpsilon) {
+			continue
+		}
+		if n.leaf {
+			*out = append(*out, e.key)
+		} else {
+			queryNode(e.child, box, out)
+		}
+	}
+}
+
+// CanonicalKey produces a rotation- and translation-quantized signature
+// for a kite's placement, letting two kites be compared for exact
+// equality (modulo floating-point roundoff) once their bounding boxes
+// are already known to overlap.
+func CanonicalKey(k kite) [3]float64 {
+	const quanta = 1e3
+	round := func(v float64) float64 { return math.Round(v*quanta) / quanta }
+	return [3]float64{round(k.pos[0]), round(k.pos[1]), round(float64(norm360(k.rot)))}
+}
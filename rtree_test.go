@@ -0,0 +1,100 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestSplitNodeIndependentBackingArrays guards against a regression
+// where splitNode's two halves shared one backing array (entries[:mid]
+// and entries[mid:] of the same slice): a later Insert landing in one
+// half would silently overwrite the other half's entries in place.
+func TestSplitNodeIndependentBackingArrays(t *testing.T) {
+	idx := &TileIndex{}
+	for i := 0; i < rtreeNodeSize+1; i++ { // forces exactly one split
+		x := float64(i)
+		idx.Insert(bbox{x, 0, x + 0.1, 0.1}, i)
+	}
+	// Insert one more, landing near the low end of the x range, which
+	// previously could clobber an entry on the high end sharing its
+	// backing array.
+	idx.Insert(bbox{0.05, 1, 0.15, 1.1}, 100)
+
+	want := map[any]bool{100: true}
+	for i := 0; i < rtreeNodeSize+1; i++ {
+		want[i] = true
+	}
+	got := idx.Query(bbox{-1, -1, 100, 100})
+	if len(got) != len(want) {
+		t.Fatalf("Query returned %d keys, want %d: %v", len(got), len(want), got)
+	}
+	seen := map[any]bool{}
+	for _, k := range got {
+		if seen[k] {
+			t.Fatalf("key %v returned more than once: entries were clobbered", k)
+		}
+		seen[k] = true
+		if !want[k] {
+			t.Fatalf("unexpected key %v", k)
+		}
+	}
+}
+
+// TestNewTileIndexBulkLoad checks that the STR bulk loader produces a
+// tree whose Query results agree with a brute-force scan, and that
+// every node respects the fan-out it was built for.
+func TestNewTileIndexBulkLoad(t *testing.T) {
+	var boxes []bbox
+	var keys []any
+	for i := 0; i < 500; i++ {
+		x, y := float64(i%25), float64(i/25)
+		boxes = append(boxes, bbox{x, y, x + 1.5, y + 1.5}) // overlaps its grid neighbors
+		keys = append(keys, i)
+	}
+	index := NewTileIndex(boxes, keys)
+
+	checkNode(t, index.root)
+
+	for i, box := range boxes {
+		var want []any
+		for j, other := range boxes {
+			if box.overlaps(other, tileEpsilon) {
+				want = append(want, keys[j])
+			}
+		}
+		got := index.Query(box)
+		if len(got) != len(want) {
+			t.Fatalf("box %d: Query returned %d keys, want %d", i, len(got), len(want))
+		}
+		wantSet := map[any]bool{}
+		for _, k := range want {
+			wantSet[k] = true
+		}
+		for _, k := range got {
+			if !wantSet[k] {
+				t.Fatalf("box %d: Query returned unexpected key %v", i, k)
+			}
+		}
+	}
+}
+
+// checkNode recursively verifies that n's fan-out is within
+// rtreeNodeSize and that its box is the exact union of its entries'.
+func checkNode(t *testing.T, n *rnode) {
+	t.Helper()
+	if n == nil {
+		return
+	}
+	if len(n.entries) > rtreeNodeSize {
+		t.Fatalf("node has %d entries, want at most %d", len(n.entries), rtreeNodeSize)
+	}
+	if n.box != entriesBox(n.entries) {
+		t.Fatalf("node box %v does not match union of its entries' boxes %v", n.box, entriesBox(n.entries))
+	}
+	if !n.leaf {
+		for _, e := range n.entries {
+			checkNode(t, e.child)
+		}
+	}
+}
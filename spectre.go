@@ -0,0 +1,236 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"math"
+)
+
+// This file implements the "spectre" tile, the strictly chiral monotile
+// that followed the original reflection-requiring hat. Like Kite, it
+// builds a flat polygon (here 14 unit edges rather than a kite's four)
+// and extrudes it into a prism, with the same inset-groove trick
+// generalized from a quad to an n-gon: each edge is offset inward by
+// inset, and the new vertices are the intersections of consecutive
+// offset edges.
+
+// spectreTurns gives the exterior turning angle, in degrees, at each of
+// the spectre's 14 vertices; like the kite's own rotations, they are
+// all multiples of 60. The sequence was chosen, among the many that sum
+// to a full turn, for being one that closes into a simple polygon.
+var spectreTurns = [14]int{
+	-60, -60, 60, 60, 60, 60, -60, 60, 60, -60, 60, 60, 60, 60,
+}
+
+// spectreUnitPolygon returns the spectre's 14 vertices with unit edges,
+// starting at the origin heading along the x axis.
+func spectreUnitPolygon() [14]Point2D {
+	var pts [14]Point2D
+	x, y := 0., 0.
+	heading := 0.
+	for i, turn := range spectreTurns {
+		pts[i] = Point2D{x, y}
+		h := heading / rad
+		x, y = x+math.Cos(h), y+math.Sin(h)
+		heading += float64(turn)
+	}
+	return pts
+}
+
+// spectrePolygon computes the transformed outline of a spectre tile:
+// insetting, scaling to unit size, rotating and translating, the same
+// sequence kitePolygon applies to a kite.
+func spectrePolygon(loc [2]float64, rotationDegrees int, inset float64) [14]Point2D {
+	poly := spectreUnitPolygon()
+	if inset > 0 {
+		poly = offsetPolygon(poly, inset)
+	}
+	θ := float64(rotationDegrees) / rad
+	sinθ, cosθ := math.Sin(θ), math.Cos(θ)
+	dx, dy := loc[0]*unit, loc[1]*unit
+	for i, p := range poly {
+		x, y := p.X*unit, p.Y*unit
+		poly[i] = Point2D{x*cosθ - y*sinθ + dx, x*sinθ + y*cosθ + dy}
+	}
+	return poly
+}
+
+// offsetPolygon insets poly by dist: each edge is pushed inward along
+// its own normal by dist, and each new vertex is recomputed as the
+// intersection of the two offset edges that met at the original
+// vertex. This generalizes the deflate-and-translate inset kitePolygon
+// uses for a quad to an arbitrary simple polygon.
+func offsetPolygon(poly [14]Point2D, dist float64) [14]Point2D {
+	n := len(poly)
+	type line struct{ a, b Point2D }
+	lines := make([]line, n)
+	for i := 0; i < n; i++ {
+		p0, p1 := poly[i], poly[(i+1)%n]
+		dx, dy := p1.X-p0.X, p1.Y-p0.Y
+		length := math.Hypot(dx, dy)
+		// Left normal of the edge direction; poly is wound so inward is left.
+		nx, ny := -dy/length*dist, dx/length*dist
+		lines[i] = line{Point2D{p0.X + nx, p0.Y + ny}, Point2D{p1.X + nx, p1.Y + ny}}
+	}
+	var out [14]Point2D
+	for i := 0; i < n; i++ {
+		prev := lines[(i-1+n)%n]
+		cur := lines[i]
+		out[i] = lineIntersection(prev.a, prev.b, cur.a, cur.b)
+	}
+	return out
+}
+
+// lineIntersection returns the intersection of lines p1p2 and p3p4,
+// falling back to p2 if the lines are parallel. In offsetPolygon that
+// happens when two consecutive edges are collinear, and p2 is then the
+// shared vertex already pushed inward.
+func lineIntersection(p1, p2, p3, p4 Point2D) Point2D {
+	x1, y1, x2, y2 := p1.X, p1.Y, p2.X, p2.Y
+	x3, y3, x4, y4 := p3.X, p3.Y, p4.X, p4.Y
+	denom := (x1-x2)*(y3-y4) - (y1-y2)*(x3-x4)
+	if denom == 0 {
+		return p2
+	}
+	a := x1*y2 - y1*x2
+	b := x3*y4 - y3*x4
+	px := (a*(x3-x4) - (x1-x2)*b) / denom
+	py := (a*(y3-y4) - (y1-y2)*b) / denom
+	return Point2D{px, py}
+}
+
+// Spectre builds the prism for one spectre tile, the way Kite builds
+// one for a kite. There is no reflect parameter: the spectre tiles
+// aperiodically without ever needing a mirrored copy.
+func Spectre(loc [2]float64, rotationDegrees int, inset float64) Prism {
+	poly := spectrePolygon(loc, rotationDegrees, inset)
+	bot := make([]Point, len(poly))
+	top := make([]Point, len(poly))
+	height := (0.2 + inset) * unit
+	for i, p := range poly {
+		bot[i] = Point{p.X, p.Y, 0}
+		top[i] = Point{p.X, p.Y, height}
+	}
+	return NewPrism(bot, top)
+}
+
+// Prism is an extruded n-gon, generalizing Box (an extruded quad) to
+// the spectre's 14-sided outline. bot must wind counterclockwise as
+// seen from above; top lists the same polygon directly above it, at
+// whatever height the caller chose.
+type Prism struct {
+	bot, top []Point
+}
+
+func NewPrism(bot, top []Point) Prism {
+	if len(bot) != len(top) || len(bot) < 3 {
+		log.Fatal("bad prism polygons")
+	}
+	p := Prism{bot, top}
+	f := p.Facets()
+	if f[0].Normal().z >= 0 {
+		log.Fatal("bad bottom normal")
+	}
+	if f[len(bot)-2].Normal().z <= 0 {
+		log.Fatal("bad top normal")
+	}
+	return p
+}
+
+func (p Prism) Facets() []Facet {
+	n := len(p.bot)
+	poly := make([]Point2D, n)
+	for i, v := range p.bot {
+		poly[i] = Point2D{v.x, v.y}
+	}
+	// The spectre's outline is not convex, so the caps need real
+	// triangulation, not a fan from one vertex: ear clipping finds a
+	// triangle (a, b, c) with a, b, c in original polygon order for each
+	// triangle, which for our counterclockwise bot gives a facet normal
+	// pointing up; reversing b and c gives the bottom cap's downward one.
+	ears := triangulatePolygon(poly)
+	facets := make([]Facet, 0, len(ears)*2+2*n)
+	for _, e := range ears {
+		facets = append(facets, Facet{p.bot[e[0]], p.bot[e[2]], p.bot[e[1]]})
+	}
+	for _, e := range ears {
+		facets = append(facets, Facet{p.top[e[0]], p.top[e[1]], p.top[e[2]]})
+	}
+	// Sides: bot is counterclockwise from above, so bot[i],bot[j],top[j],top[i]
+	// already has an outward-facing normal; no index juggling needed.
+	for i := 0; i < n; i++ {
+		j := (i + 1) % n
+		q := Quad{p.bot[i], p.bot[j], p.top[j], p.top[i]}
+		f := q.Facets()
+		facets = append(facets, f[0], f[1])
+	}
+	return facets
+}
+
+// triangulatePolygon triangulates a simple, counterclockwise polygon by
+// ear clipping: repeatedly find a convex vertex whose triangle with its
+// neighbors contains no other vertex, and clip it off. It returns each
+// ear as the three indices (a, b, c), in the polygon's own order.
+func triangulatePolygon(poly []Point2D) [][3]int {
+	idx := make([]int, len(poly))
+	for i := range idx {
+		idx[i] = i
+	}
+	var ears [][3]int
+	for len(idx) > 3 {
+		clipped := false
+		for i := range idx {
+			a := idx[(i-1+len(idx))%len(idx)]
+			b := idx[i]
+			c := idx[(i+1)%len(idx)]
+			if isEar(poly, idx, a, b, c) {
+				ears = append(ears, [3]int{a, b, c})
+				idx = append(idx[:i], idx[i+1:]...)
+				clipped = true
+				break
+			}
+		}
+		if !clipped {
+			break // degenerate input; emit whatever triangles we already found
+		}
+	}
+	if len(idx) == 3 {
+		ears = append(ears, [3]int{idx[0], idx[1], idx[2]})
+	}
+	return ears
+}
+
+// isEar reports whether (a, b, c) is a convex vertex of the polygon
+// that contains none of its other, not-yet-clipped vertices.
+func isEar(poly []Point2D, idx []int, a, b, c int) bool {
+	if cross2D(poly[a], poly[b], poly[c]) <= 0 {
+		return false
+	}
+	for _, p := range idx {
+		if p == a || p == b || p == c {
+			continue
+		}
+		if inTriangle(poly[p], poly[a], poly[b], poly[c]) {
+			return false
+		}
+	}
+	return true
+}
+
+// cross2D is twice the signed area of triangle (o, a, b): positive when
+// o->a->b turns left.
+func cross2D(o, a, b Point2D) float64 {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+func inTriangle(p, a, b, c Point2D) bool {
+	d1 := cross2D(a, b, p)
+	d2 := cross2D(b, c, p)
+	d3 := cross2D(c, a, p)
+	neg := d1 < 0 || d2 < 0 || d3 < 0
+	pos := d1 > 0 || d2 > 0 || d3 > 0
+	return !(neg && pos)
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// WriteBinarySTL writes hats as a single binary STL file: an 80-byte
+// header, a little-endian uint32 triangle count, and then 50 bytes per
+// triangle (a float32 normal, three float32 vertices, and a uint16
+// attribute byte count, always zero, that slicers ignore). This is the
+// format large substitution patches should use instead of the ASCII
+// form printSTL produces, which balloons at any real size.
+func WriteBinarySTL(w io.Writer, hats []placedHat) error {
+	var facets []Facet
+	for _, h := range hats {
+		if *tile == "spectre" {
+			facets = append(facets, Spectre(h.pos, h.rot, 0).Facets()...)
+			facets = append(facets, Spectre(h.pos, h.rot, inset).Facets()...)
+			continue
+		}
+		for _, part := range kites {
+			k := placeKite(h, part)
+			solid := Kite(k.pos, k.rot, 0, h.reflect).Facets()
+			inner := Kite(k.pos, k.rot, inset, h.reflect).Facets()
+			facets = append(facets, solid[:]...)
+			facets = append(facets, inner[:]...)
+		}
+	}
+
+	var header [80]byte
+	copy(header[:], "binary STL generated by robpike.io/cmd/einstein")
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(facets))); err != nil {
+		return err
+	}
+	for _, f := range facets {
+		if err := writeBinaryFacet(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeBinaryFacet(w io.Writer, f Facet) error {
+	n := f.Normal()
+	vals := [12]float32{
+		float32(n.x), float32(n.y), float32(n.z),
+		float32(f[0].x), float32(f[0].y), float32(f[0].z),
+		float32(f[1].x), float32(f[1].y), float32(f[1].z),
+		float32(f[2].x), float32(f[2].y), float32(f[2].z),
+	}
+	if err := binary.Write(w, binary.LittleEndian, vals[:]); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, uint16(0))
+}
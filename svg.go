@@ -0,0 +1,87 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SVGRenderer renders a patch of hats as an SVG document. Each hat
+// becomes one <path>, filled according to whether it is reflected and
+// stroked to show the groove that, in the STL output, is a physical
+// inset cut into the hat.
+type SVGRenderer struct {
+	StrokeWidth float64
+	Fill        string // fill color for ordinary hats
+	ReflectFill string // fill color for reflected hats
+}
+
+// NewSVGRenderer returns an SVGRenderer with reasonable defaults.
+func NewSVGRenderer() *SVGRenderer {
+	return &SVGRenderer{
+		StrokeWidth: 0.05 * unit,
+		Fill:        "#dddddd",
+		ReflectFill: "#99aadd",
+	}
+}
+
+// Render returns hats as a complete SVG document, sized to their
+// bounding box.
+func (r *SVGRenderer) Render(hats []placedHat) string {
+	minX, minY, maxX, maxY := hatBounds(hats)
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"%.3f %.3f %.3f %.3f\">\n",
+		minX, minY, maxX-minX, maxY-minY)
+	for _, h := range hats {
+		fill := r.Fill
+		if h.reflect {
+			fill = r.ReflectFill
+		}
+		fmt.Fprintf(&b, "  <path d=%q fill=%q stroke=\"black\" stroke-width=\"%.3f\"/>\n",
+			hatPath(h), fill, r.StrokeWidth)
+	}
+	fmt.Fprintln(&b, "</svg>")
+	return b.String()
+}
+
+// hatPolygons returns the eight kite outlines, one per part of the
+// kites table, that together make up hat h.
+func hatPolygons(h placedHat) [][4]Point2D {
+	polys := make([][4]Point2D, len(kites))
+	for i, part := range kites {
+		k := placeKite(h, part)
+		polys[i] = kitePolygon(k.pos, k.rot, 0, h.reflect)
+	}
+	return polys
+}
+
+// hatPath builds an SVG path "d" attribute with one closed subpath per
+// kite part of the hat.
+func hatPath(h placedHat) string {
+	var b strings.Builder
+	for _, poly := range hatPolygons(h) {
+		fmt.Fprintf(&b, "M%.3f,%.3f L%.3f,%.3f L%.3f,%.3f L%.3f,%.3f Z ",
+			poly[0].X, poly[0].Y, poly[1].X, poly[1].Y, poly[2].X, poly[2].Y, poly[3].X, poly[3].Y)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// hatBounds returns the axis-aligned bounding box of every kite part of
+// every hat in hats.
+func hatBounds(hats []placedHat) (minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, h := range hats {
+		for _, poly := range hatPolygons(h) {
+			for _, p := range poly {
+				minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+				minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+			}
+		}
+	}
+	return
+}
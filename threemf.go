@@ -0,0 +1,109 @@
+// Copyright 2023 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Write3MF writes hats as a 3MF package: a zip archive holding a single
+// 3D/3dmodel.model with one <object> per hat -- its eight kite parts
+// merged into a single mesh -- and a <build> that places every object,
+// so slicers can select or color a whole (possibly reflected) hat as
+// one unit instead of eight independent parts.
+func Write3MF(w io.Writer, hats []placedHat) error {
+	zw := zip.NewWriter(w)
+	if err := writeZipFile(zw, "[Content_Types].xml", contentTypesXML); err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, "_rels/.rels", relsXML); err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, "3D/3dmodel.model", modelXML(hats)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+const contentTypesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+  <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`
+
+const relsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rel0" Target="/3D/3dmodel.model" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`
+
+func writeZipFile(zw *zip.Writer, name, content string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+// modelXML builds the 3D/3dmodel.model document: one <object> per hat,
+// each with a single <mesh> holding all eight of its kite parts' facets,
+// and a <build> with one <item> per hat.
+func modelXML(hats []placedHat) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(&b, `<model unit="millimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">`)
+	fmt.Fprintln(&b, "  <resources>")
+	var ids []int
+	id := 1
+	for _, h := range hats {
+		fmt.Fprintf(&b, "    <object id=\"%d\" type=\"model\">\n", id)
+		writeHatMesh(&b, h)
+		fmt.Fprintln(&b, "    </object>")
+		ids = append(ids, id)
+		id++
+	}
+	fmt.Fprintln(&b, "  </resources>")
+	fmt.Fprintln(&b, "  <build>")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "    <item objectid=\"%d\"/>\n", id)
+	}
+	fmt.Fprintln(&b, "  </build>")
+	fmt.Fprintln(&b, "</model>")
+	return b.String()
+}
+
+// writeHatMesh emits one hat's <mesh>: every facet of every one of its
+// eight kite parts, listed as vertices and then indexed as triangles.
+// 3MF has no notion of the shared quads Box.Facets() groups facets
+// into, so vertices are not deduplicated across facets, nor across
+// parts.
+func writeHatMesh(b *strings.Builder, h placedHat) {
+	var facets []Facet
+	for _, part := range kites {
+		k := placeKite(h, part)
+		box := Kite(k.pos, k.rot, 0, h.reflect).Facets()
+		facets = append(facets, box[:]...)
+	}
+	fmt.Fprintln(b, "      <mesh>")
+	fmt.Fprintln(b, "        <vertices>")
+	for _, f := range facets {
+		for _, p := range f {
+			fmt.Fprintf(b, "          <vertex x=\"%.6f\" y=\"%.6f\" z=\"%.6f\"/>\n", p.x, p.y, p.z)
+		}
+	}
+	fmt.Fprintln(b, "        </vertices>")
+	fmt.Fprintln(b, "        <triangles>")
+	for i := range facets {
+		v0, v1, v2 := 3*i, 3*i+1, 3*i+2
+		fmt.Fprintf(b, "          <triangle v1=\"%d\" v2=\"%d\" v3=\"%d\"/>\n", v0, v1, v2)
+	}
+	fmt.Fprintln(b, "        </triangles>")
+	fmt.Fprintln(b, "      </mesh>")
+}